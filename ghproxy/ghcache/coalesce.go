@@ -0,0 +1,133 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ghcache
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/test-infra/ghproxy/ghmetrics"
+)
+
+// requestCoalescer collapses concurrent GET requests for the same cache key
+// into a single call to its delegate, with the response copied to every
+// caller. This saves API tokens whenever the same resource is requested by
+// multiple callers (e.g. several Prow jobs polling the same PR) before the
+// first request's response has been cached.
+type requestCoalescer struct {
+	delegate http.RoundTripper
+	hasher   ghmetrics.Hasher
+	tracer   trace.Tracer
+
+	mu   sync.Mutex
+	keys map[string]*responseWaiter
+}
+
+// responseWaiter lets every caller other than the one that actually issued
+// the request wait for, and then copy, its response.
+type responseWaiter struct {
+	done chan struct{}
+	resp *http.Response
+	body []byte
+	err  error
+}
+
+func (coalescer *requestCoalescer) RoundTrip(req *http.Request) (*http.Response, error) {
+	// A forced refresh must not be silently handed to, or served from,
+	// another caller's in-flight conditional request, so skip coalescing
+	// entirely for it. CacheRequestModeBypass is an alias for
+	// CacheRequestModeBypassRequest (see its doc comment) and must be
+	// skipped the same way. Every other mode, including bypass_response,
+	// still participates as a reader.
+	mode := cacheRequestMode(req)
+	if mode == CacheRequestModeBypassRequest || mode == CacheRequestModeBypass {
+		// A request-side no-cache makes httpcache go upstream even for an
+		// entry that is still fresh, such as a negative-cache entry within
+		// its TTL, which it would otherwise serve without a round trip.
+		req = req.Clone(req.Context())
+		req.Header.Set("Cache-Control", "no-cache")
+		return coalescer.delegate.RoundTrip(req)
+	}
+	if req.Method != http.MethodGet {
+		return coalescer.delegate.RoundTrip(req)
+	}
+
+	key := tokenBudgetIdentifier(req, coalescer.hasher) + "|" + req.URL.String()
+
+	coalescer.mu.Lock()
+	waiter, ok := coalescer.keys[key]
+	if ok {
+		coalescer.mu.Unlock()
+		return coalescer.join(req, waiter)
+	}
+
+	waiter = &responseWaiter{done: make(chan struct{})}
+	coalescer.keys[key] = waiter
+	coalescer.mu.Unlock()
+
+	resp, err := coalescer.delegate.RoundTrip(req)
+	waiter.resp, waiter.body, waiter.err = snapshotResponse(resp, err)
+	close(waiter.done)
+
+	coalescer.mu.Lock()
+	delete(coalescer.keys, key)
+	coalescer.mu.Unlock()
+
+	return resp, err
+}
+
+// join waits for waiter's leader request to finish and returns a copy of its
+// response. The span it records measures the time spent waiting to join a
+// coalesced leader.
+func (coalescer *requestCoalescer) join(req *http.Request, waiter *responseWaiter) (*http.Response, error) {
+	_, span := coalescer.tracer.Start(req.Context(), "requestCoalescer.RoundTrip")
+	defer span.End()
+	span.SetAttributes(attribute.Bool("coalesced", true))
+
+	<-waiter.done
+	if waiter.err != nil {
+		return nil, waiter.err
+	}
+
+	resp := new(http.Response)
+	*resp = *waiter.resp
+	resp.Header = waiter.resp.Header.Clone()
+	resp.Header.Set(CacheModeHeader, string(ModeCoalesced))
+	resp.Body = ioutil.NopCloser(bytes.NewReader(waiter.body))
+	return resp, nil
+}
+
+// snapshotResponse buffers resp's body so it can be replayed both to the
+// caller that triggered the request and to every caller that coalesced onto
+// it, then restores resp.Body so the original caller still sees the full
+// response.
+func snapshotResponse(resp *http.Response, err error) (*http.Response, []byte, error) {
+	if err != nil || resp == nil {
+		return resp, nil, err
+	}
+	body, readErr := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if readErr != nil {
+		return resp, nil, readErr
+	}
+	return resp, body, nil
+}
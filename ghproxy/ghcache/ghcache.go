@@ -26,29 +26,37 @@ limitations under the License.
 package ghcache
 
 import (
+	"bytes"
+	"container/list"
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"math"
 	"net/http"
 	"os"
 	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 
-	"github.com/gomodule/redigo/redis"
+	goredis "github.com/go-redis/redis/v9"
 	"github.com/gregjones/httpcache"
 	"github.com/gregjones/httpcache/diskcache"
-	rediscache "github.com/gregjones/httpcache/redis"
 	"github.com/peterbourgon/diskv"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/sirupsen/logrus"
-	"golang.org/x/sync/semaphore"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"k8s.io/test-infra/ghproxy/ghmetrics"
 )
 
@@ -62,6 +70,12 @@ const (
 	ModeNoStore CacheResponseMode = "NO-STORE" // response not cacheable
 	ModeMiss    CacheResponseMode = "MISS"     // not in cache, request proxied and response cached.
 	ModeChanged CacheResponseMode = "CHANGED"  // cache value invalid: resource changed, cache updated
+	// ModeNegative marks a response for a known-missing resource (see
+	// defaultNegativeCacheStatusCodes) that was served from a short-TTL
+	// negative cache entry instead of GitHub's normal always-revalidate
+	// policy. The upstream response that first writes such an entry is
+	// reported as ModeMiss.
+	ModeNegative CacheResponseMode = "NEGATIVE"
 	// The modes below are the happy cases in which the request is fulfilled for
 	// free (no API tokens used).
 	ModeCoalesced   CacheResponseMode = "COALESCED"   // coalesced request, this is a copied response
@@ -75,17 +89,102 @@ const (
 	// the Authorization header will be used.
 	TokenBudgetIdentifierHeader = "X-PROW-GHCACHE-TOKEN-BUDGET-IDENTIFIER"
 
+	// negativeCacheHeader marks a stored response as belonging to
+	// ghcache's negative-response cache. It's set on both the initial,
+	// token-costing write and every subsequent, free cache-only read, so
+	// cacheResponseMode additionally gates on httpcache's XFromCache marker
+	// (see the MarkCachedResponses setting in NewFromCache) to tell the two
+	// apart: only a read that httpcache actually served from its cache
+	// storage is free.
+	negativeCacheHeader = "X-PROW-NEGATIVE-CACHE"
+
+	// NegativeTTLHeader lets a caller override the negative-response cache
+	// TTL for a single request. Its value must be parseable by
+	// time.ParseDuration.
+	NegativeTTLHeader = "X-PROW-NEGATIVE-TTL"
+
 	// TokenExpiryAtHeader includes a date at which the passed token expires and all associated caches
 	// can be cleaned up. It's value must be in RFC3339 format.
 	TokenExpiryAtHeader = "X-PROW-TOKEN-EXPIRES-AT"
+
+	// CacheRequestModeHeader lets a caller override ghcache's normal
+	// always-revalidate behavior for a single request. See
+	// CacheRequestMode for the supported values.
+	CacheRequestModeHeader = "X-PROW-CACHE-MODE"
 )
 
+// CacheRequestMode selects how a single request interacts with the cache,
+// overriding ghcache's normal behavior of always revalidating a cache entry
+// with a conditional request upstream.
+type CacheRequestMode string
+
+const (
+	// CacheRequestModeDefault preserves ghcache's normal always-revalidate
+	// behavior.
+	CacheRequestModeDefault CacheRequestMode = "default"
+	// CacheRequestModeBypass ignores any cached entry, fetches a fresh
+	// response upstream, and stores it for subsequent requests. Alias for
+	// CacheRequestModeBypassRequest.
+	CacheRequestModeBypass CacheRequestMode = "bypass"
+	// CacheRequestModeBypassRequest ignores any cached entry, fetches a
+	// fresh response upstream, and stores it. Unlike the default mode, this
+	// does not join the request coalescer: a forced refresh must not be
+	// silently handed to, or served from, another caller's in-flight
+	// conditional request.
+	CacheRequestModeBypassRequest CacheRequestMode = "bypass_request"
+	// CacheRequestModeBypassResponse serves the existing cache entry, if
+	// any, without revalidating it upstream, but still joins the request
+	// coalescer as a reader. Useful for serving cheap, possibly-stale
+	// responses during a GitHub outage. A stale entry is recognized by the
+	// ETag or Last-Modified validator httpcache sends for it; a stale entry
+	// stored with neither (such as an expired negative-cache entry) is
+	// treated as missing.
+	CacheRequestModeBypassResponse CacheRequestMode = "bypass_response"
+	// CacheRequestModeStrict serves the existing cache entry, if any,
+	// without touching upstream, and fails the request outright if no
+	// entry exists. Stale entries are recognized as for
+	// CacheRequestModeBypassResponse.
+	CacheRequestModeStrict CacheRequestMode = "strict"
+)
+
+// cacheRequestMode returns the CacheRequestMode requested by req, defaulting
+// to CacheRequestModeDefault for an unset or unrecognized header value.
+func cacheRequestMode(req *http.Request) CacheRequestMode {
+	switch mode := CacheRequestMode(req.Header.Get(CacheRequestModeHeader)); mode {
+	case CacheRequestModeBypass, CacheRequestModeBypassRequest, CacheRequestModeBypassResponse, CacheRequestModeStrict:
+		return mode
+	default:
+		return CacheRequestModeDefault
+	}
+}
+
+// syntheticNotModified builds a 304 response for req without making an
+// upstream call, so httpcache continues serving whatever entry it already
+// has cached.
+func syntheticNotModified(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:     "304 Not Modified",
+		StatusCode: http.StatusNotModified,
+		Proto:      req.Proto,
+		ProtoMajor: req.ProtoMajor,
+		ProtoMinor: req.ProtoMinor,
+		Header:     http.Header{},
+		Body:       http.NoBody,
+		Request:    req,
+	}
+}
+
 func CacheModeIsFree(mode CacheResponseMode) bool {
 	switch mode {
 	case ModeCoalesced:
 		return true
 	case ModeRevalidated:
 		return true
+	case ModeNegative:
+		// Only reached once cacheResponseMode has already confirmed this
+		// was an actual cache-only read, not the fresh write that first
+		// populated the negative-cache entry.
+		return true
 	case ModeError:
 		// In this case we did not successfully communicate with the GH API, so no
 		// token is used, but we also don't return a response, so ModeError won't
@@ -117,14 +216,51 @@ var cachePartitionsCounter = prometheus.NewCounterVec(
 	[]string{"token_hash"},
 )
 
+// effectiveConcurrencyGauge reports the current adaptive outbound
+// concurrency ceiling per token budget, as adjusted by throttlingTransport
+// in response to GitHub rate-limit headers.
+var effectiveConcurrencyGauge = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "ghcache_effective_concurrency",
+		Help: "Current adaptive outbound concurrency ceiling, per token budget.",
+	},
+	[]string{"token_budget"},
+)
+
+// tierHitsCounter counts cache hits by which tier of a two-tier cache
+// served them.
+var tierHitsCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "ghcache_tier_hits_total",
+		Help: "Count of cache hits, broken down by which tier served them.",
+	},
+	[]string{"tier"},
+)
+
+// tierBytesGauge reports the current size, in bytes, of a partition's
+// in-memory LRU tier.
+var tierBytesGauge = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "ghcache_tier_mem_bytes",
+		Help: "Current size in bytes of the in-memory LRU tier, per cache partition.",
+	},
+	[]string{"partition"},
+)
+
 func init() {
 
 	prometheus.MustRegister(outboundConcurrencyGauge)
 	prometheus.MustRegister(pendingOutboundConnectionsGauge)
 	prometheus.MustRegister(cachePartitionsCounter)
+	prometheus.MustRegister(effectiveConcurrencyGauge)
+	prometheus.MustRegister(tierHitsCounter)
+	prometheus.MustRegister(tierBytesGauge)
 }
 
 func cacheResponseMode(headers http.Header) CacheResponseMode {
+	if headers.Get(negativeCacheHeader) != "" && headers.Get(httpcache.XFromCache) != "" {
+		return ModeNegative
+	}
 	if strings.Contains(headers.Get("Cache-Control"), "no-store") {
 		return ModeNoStore
 	}
@@ -137,27 +273,466 @@ func cacheResponseMode(headers http.Header) CacheResponseMode {
 	return ModeMiss
 }
 
-func newThrottlingTransport(maxConcurrency int, delegate http.RoundTripper) http.RoundTripper {
-	return &throttlingTransport{sem: semaphore.NewWeighted(int64(maxConcurrency)), delegate: delegate}
+// defaultCeilingRecoveryInterval is how long a token budget must go without
+// a secondary rate limit penalty before its concurrency ceiling is grown
+// again.
+const defaultCeilingRecoveryInterval = 5 * time.Minute
+
+// throttlingConfig customizes the adaptive throttling behavior applied to
+// outbound GitHub requests. It is populated via Options passed to
+// NewFromCache.
+type throttlingConfig struct {
+	ceilingRecoveryInterval time.Duration
+}
+
+func defaultThrottlingConfig() throttlingConfig {
+	return throttlingConfig{ceilingRecoveryInterval: defaultCeilingRecoveryInterval}
+}
+
+// config bundles the optional behavior NewFromCache's caller can customize
+// via Option.
+type config struct {
+	throttling     throttlingConfig
+	tracerProvider trace.TracerProvider
+	negative       negativeCacheConfig
+}
+
+func defaultConfig() config {
+	return config{
+		throttling:     defaultThrottlingConfig(),
+		tracerProvider: otel.GetTracerProvider(),
+		negative:       defaultNegativeCacheConfig(),
+	}
 }
 
-// throttlingTransport throttles outbound concurrency from the proxy
+// defaultNegativeCacheTTL is how long a negative-cacheable response (see
+// defaultNegativeCacheStatusCodes) is served from cache before GitHub is
+// asked about the resource again.
+const defaultNegativeCacheTTL = 5 * time.Minute
+
+// negativeCacheConfig customizes which upstream error responses are cached
+// with a short TTL instead of being marked no-store, and for how long.
+type negativeCacheConfig struct {
+	ttl         time.Duration
+	statusCodes map[int]bool
+}
+
+func defaultNegativeCacheConfig() negativeCacheConfig {
+	return negativeCacheConfig{
+		ttl: defaultNegativeCacheTTL,
+		statusCodes: map[int]bool{
+			http.StatusNotFound:            true,
+			http.StatusGone:                true,
+			http.StatusUnprocessableEntity: true,
+		},
+	}
+}
+
+// WithNegativeCacheTTL overrides how long a negative-cacheable response
+// (see WithNegativeCacheStatusCodes) is served from cache before GitHub is
+// asked about the resource again. Defaults to 5 minutes. The TTL is sent as
+// a max-age in whole seconds, so any fraction of a second is dropped.
+func WithNegativeCacheTTL(d time.Duration) Option {
+	return func(c *config) { c.negative.ttl = d }
+}
+
+// WithNegativeCacheStatusCodes overrides which upstream status codes are
+// treated as "known-missing" and cached with a short TTL instead of being
+// marked no-store. Defaults to 404, 410, and 422: GitHub doesn't honor
+// conditional requests for missing resources, so re-querying a known-missing
+// PR/comment/branch would otherwise burn an API token every time.
+func WithNegativeCacheStatusCodes(codes ...int) Option {
+	return func(c *config) {
+		statusCodes := make(map[int]bool, len(codes))
+		for _, code := range codes {
+			statusCodes[code] = true
+		}
+		c.negative.statusCodes = statusCodes
+	}
+}
+
+// Option customizes the behavior of a cache RoundTripper created by
+// NewFromCache.
+type Option func(*config)
+
+// WithCeilingRecoveryInterval overrides how long a token budget must remain
+// free of secondary rate limit penalties before its concurrency ceiling is
+// grown again (additive increase).
+func WithCeilingRecoveryInterval(d time.Duration) Option {
+	return func(c *config) { c.throttling.ceilingRecoveryInterval = d }
+}
+
+// WithTracerProvider registers the trace.TracerProvider used to create spans
+// for the coalesce -> cache -> upstream request path. If unset, the tracer
+// provider registered globally via otel.SetTracerProvider is used.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(c *config) { c.tracerProvider = tp }
+}
+
+// tracerName identifies ghcache's spans to whatever exporter the caller
+// configured via WithTracerProvider.
+const tracerName = "k8s.io/test-infra/ghproxy/ghcache"
+
+// budgetIdleTimeout is how long a token budget can go without a request
+// before its state, and the recoveryLoop goroutine backing it, are torn
+// down. NewFromCache builds one throttlingTransport per cache partition, and
+// partitions are keyed the same way as token budgets, so a transport
+// normally holds a single budget; its reapIdleBudgets goroutine keeps
+// running for the transport's lifetime even after that budget is removed.
+const budgetIdleTimeout = 30 * time.Minute
+
+func newThrottlingTransport(maxConcurrency int, hasher ghmetrics.Hasher, delegate http.RoundTripper, tracer trace.Tracer, throttling throttlingConfig) http.RoundTripper {
+	c := &throttlingTransport{
+		maxConcurrency: maxConcurrency,
+		hasher:         hasher,
+		delegate:       delegate,
+		tracer:         tracer,
+		config:         throttling,
+		budgets:        map[string]*throttleBudget{},
+	}
+	go c.reapIdleBudgets()
+	return c
+}
+
+// throttlingTransport throttles outbound concurrency from the proxy.
+//
+// Concurrency is tracked per token budget rather than globally: each budget
+// gets its own token-bucket style concurrency ceiling, refilled from the
+// GitHub rate-limit headers observed on its responses, and shrunk
+// (multiplicative decrease) whenever a secondary rate limit is hit. This
+// keeps one hot token budget from starving others and stops the proxy from
+// ever pounding GitHub's secondary limits.
 type throttlingTransport struct {
-	sem      *semaphore.Weighted
-	delegate http.RoundTripper
+	maxConcurrency int
+	hasher         ghmetrics.Hasher
+	delegate       http.RoundTripper
+	tracer         trace.Tracer
+	config         throttlingConfig
+
+	mu      sync.Mutex
+	budgets map[string]*throttleBudget
+}
+
+// throttleBudget tracks the adaptive concurrency state for a single token
+// budget.
+type throttleBudget struct {
+	sem  *resizableSemaphore
+	stop chan struct{}
+
+	mu          sync.Mutex
+	tokens      float64
+	resetAt     time.Time
+	ceiling     int
+	lastPenalty time.Time
+	pausedUntil time.Time
+	lastUsed    time.Time
+}
+
+func (c *throttlingTransport) budgetFor(name string) *throttleBudget {
+	c.mu.Lock()
+	b, ok := c.budgets[name]
+	if !ok {
+		b = &throttleBudget{sem: newResizableSemaphore(c.maxConcurrency), ceiling: c.maxConcurrency, stop: make(chan struct{})}
+		c.budgets[name] = b
+		effectiveConcurrencyGauge.WithLabelValues(name).Set(float64(c.maxConcurrency))
+		go b.recoveryLoop(c.maxConcurrency, c.config.ceilingRecoveryInterval, name, b.stop)
+	}
+	c.mu.Unlock()
+
+	b.mu.Lock()
+	b.lastUsed = time.Now()
+	b.mu.Unlock()
+	return b
+}
+
+// reapIdleBudgets removes, and stops the recoveryLoop goroutine for, any
+// budget that hasn't seen a request in budgetIdleTimeout. It runs for the
+// lifetime of the throttlingTransport.
+func (c *throttlingTransport) reapIdleBudgets() {
+	ticker := time.NewTicker(budgetIdleTimeout)
+	defer ticker.Stop()
+	for range ticker.C {
+		c.mu.Lock()
+		for name, b := range c.budgets {
+			b.mu.Lock()
+			idle := time.Since(b.lastUsed)
+			b.mu.Unlock()
+			if idle < budgetIdleTimeout {
+				continue
+			}
+			close(b.stop)
+			delete(c.budgets, name)
+			effectiveConcurrencyGauge.DeleteLabelValues(name)
+		}
+		c.mu.Unlock()
+	}
+}
+
+// recoveryLoop grows the ceiling back towards max (additive increase) once a
+// full recovery interval has passed without a secondary rate limit penalty.
+// It exits once stop is closed, which happens when reapIdleBudgets retires
+// this budget.
+func (b *throttleBudget) recoveryLoop(max int, interval time.Duration, name string, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			b.mu.Lock()
+			if b.ceiling < max && time.Since(b.lastPenalty) >= interval {
+				b.ceiling++
+				b.sem.setCeiling(b.ceiling)
+				effectiveConcurrencyGauge.WithLabelValues(name).Set(float64(b.ceiling))
+			}
+			b.mu.Unlock()
+		}
+	}
+}
+
+// observe updates the budget's token bucket from the rate-limit headers on
+// resp, or, if resp indicates a secondary rate limit, shrinks the ceiling
+// (multiplicative decrease) and pauses the budget for the indicated
+// duration.
+func (b *throttleBudget) observe(max int, name string, resp *http.Response) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if retryAfter, ok := secondaryRateLimitDelay(resp); ok {
+		b.ceiling = int(math.Max(1, float64(b.ceiling/2)))
+		b.sem.setCeiling(b.ceiling)
+		b.lastPenalty = time.Now()
+		b.pausedUntil = b.lastPenalty.Add(retryAfter)
+		effectiveConcurrencyGauge.WithLabelValues(name).Set(float64(b.ceiling))
+		return
+	}
+
+	remaining, err := strconv.ParseFloat(resp.Header.Get("X-RateLimit-Remaining"), 64)
+	if err != nil {
+		return
+	}
+	resetUnix, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return
+	}
+	b.tokens = remaining
+	b.resetAt = time.Unix(resetUnix, 0)
+
+	if b.tokens > 0 && b.tokens < float64(b.ceiling) {
+		if wait := time.Until(b.resetAt) / time.Duration(b.tokens); wait > 0 {
+			b.pausedUntil = time.Now().Add(wait)
+		}
+	}
+}
+
+// pauseRemaining returns how much longer the calling goroutine should wait
+// before issuing a request for this budget.
+func (b *throttleBudget) pauseRemaining() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return time.Until(b.pausedUntil)
+}
+
+// defaultSecondaryLimitBackoff is how long to pause a token budget on a
+// secondary rate limit response that doesn't carry a Retry-After header.
+// GitHub's guidance is to wait at least a minute before retrying.
+const defaultSecondaryLimitBackoff = time.Minute
+
+// secondaryLimitBodyPeekBytes bounds how much of a response body
+// secondaryRateLimitDelay reads while sniffing for a secondary rate limit
+// message, so an unexpectedly large error body can't be read into memory in
+// full.
+const secondaryLimitBodyPeekBytes = 4096
+
+// secondaryRateLimitPhrases are substrings GitHub is known to use in the body
+// of a secondary rate limit response. Matching is case-insensitive.
+var secondaryRateLimitPhrases = [][]byte{
+	[]byte("secondary rate limit"),
+	[]byte("secondary_rate_limit"),
+	[]byte("abuse detection mechanism"),
+}
+
+// secondaryRateLimitDelay reports whether resp represents a GitHub secondary
+// rate limit response and, if so, how long to back off. GitHub doesn't
+// always include a Retry-After header on these responses, so a 403/429 whose
+// body names a secondary or abuse-detection limit is also treated as one,
+// falling back to defaultSecondaryLimitBackoff.
+func secondaryRateLimitDelay(resp *http.Response) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+	if retryAfter := resp.Header.Get("Retry-After"); retryAfter != "" {
+		if secs, err := strconv.Atoi(retryAfter); err == nil && secs > 0 {
+			return time.Duration(secs) * time.Second, true
+		}
+	}
+	if secondaryRateLimitBody(resp) {
+		return defaultSecondaryLimitBackoff, true
+	}
+	return 0, false
+}
+
+// secondaryRateLimitBody peeks at resp.Body for a secondary-rate-limit
+// message, restoring resp.Body afterwards so downstream consumers (notably
+// httpcache, which needs to store the body) still see the full response.
+func secondaryRateLimitBody(resp *http.Response) bool {
+	if resp.Body == nil {
+		return false
+	}
+	peeked, err := ioutil.ReadAll(io.LimitReader(resp.Body, secondaryLimitBodyPeekBytes))
+	// Put the peeked bytes back in front of the unread rest of the body,
+	// keeping the original body's Close.
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(peeked), resp.Body), resp.Body}
+	if err != nil {
+		return false
+	}
+	lower := bytes.ToLower(peeked)
+	for _, phrase := range secondaryRateLimitPhrases {
+		if bytes.Contains(lower, phrase) {
+			return true
+		}
+	}
+	return false
+}
+
+// resizableSemaphore is a counting semaphore whose usable capacity can be
+// shrunk and grown at runtime without disturbing holders that already
+// acquired a slot. It is backed by a channel sized at the absolute maximum
+// concurrency; the unusable portion of the capacity is kept permanently
+// occupied by placeholder sends.
+//
+// Shrinking never blocks: setCeiling is called while the caller (e.g.
+// throttleBudget.observe) holds its own lock, and every slot may already be
+// held by an in-flight request that won't release it until it can itself
+// acquire that same lock. Instead, a shrink that can't be satisfied by idle
+// capacity right away is recorded as debt and paid off opportunistically —
+// either immediately, if a slot happens to be free, or by release() as
+// holders finish.
+type resizableSemaphore struct {
+	slots chan struct{}
+	max   int
+
+	mu       sync.Mutex
+	ceiling  int
+	reserved int // placeholder slots currently occupying the channel
+	debt     int // placeholder slots still owed to reach ceiling
+}
+
+func newResizableSemaphore(max int) *resizableSemaphore {
+	return &resizableSemaphore{slots: make(chan struct{}, max), max: max, ceiling: max}
+}
+
+func (s *resizableSemaphore) acquire(ctx context.Context) error {
+	select {
+	case s.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *resizableSemaphore) release() {
+	s.mu.Lock()
+	if s.debt > 0 {
+		// Convert this release into a placeholder instead of freeing the
+		// slot, paying down a pending shrink one holder at a time.
+		s.debt--
+		s.reserved++
+		s.mu.Unlock()
+		return
+	}
+	s.mu.Unlock()
+	<-s.slots
+}
+
+// setCeiling adjusts the usable capacity to n by reserving or freeing
+// placeholder slots. It never blocks: shrinking that can't be satisfied from
+// idle capacity right away is recorded as debt for release() to pay down.
+func (s *resizableSemaphore) setCeiling(n int) {
+	if n > s.max {
+		n = s.max
+	}
+	if n < 1 {
+		n = 1
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if n < s.ceiling {
+		s.debt += s.ceiling - n
+		s.ceiling = n
+		for s.debt > 0 {
+			select {
+			case s.slots <- struct{}{}:
+				s.debt--
+				s.reserved++
+			default:
+				return
+			}
+		}
+		return
+	}
+
+	grow := n - s.ceiling
+	s.ceiling = n
+	if s.debt > 0 {
+		cancel := grow
+		if cancel > s.debt {
+			cancel = s.debt
+		}
+		s.debt -= cancel
+		grow -= cancel
+	}
+	for i := 0; i < grow; i++ {
+		<-s.slots
+		s.reserved--
+	}
 }
 
 func (c *throttlingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := c.tracer.Start(req.Context(), "throttlingTransport.RoundTrip")
+	defer span.End()
+	req = req.WithContext(ctx)
+
+	budgetName := tokenBudgetIdentifier(req, c.hasher)
+	span.SetAttributes(attribute.String("token.budget", budgetName))
+	budget := c.budgetFor(budgetName)
+
+	_, semSpan := c.tracer.Start(ctx, "throttlingTransport.semaphore_wait")
 	pendingOutboundConnectionsGauge.Inc()
-	if err := c.sem.Acquire(context.Background(), 1); err != nil {
+	// Honor req.Context() here (rather than context.Background()) so that
+	// request cancellation and trace propagation actually take effect while
+	// waiting for a concurrency slot.
+	err := budget.sem.acquire(req.Context())
+	semSpan.End()
+	if err != nil {
+		pendingOutboundConnectionsGauge.Dec()
 		logrus.WithField("cache-key", req.URL.String()).WithError(err).Error("Internal error acquiring semaphore.")
+		span.RecordError(err)
 		return nil, err
 	}
-	defer c.sem.Release(1)
 	pendingOutboundConnectionsGauge.Dec()
+	defer budget.sem.release()
+
+	if wait := budget.pauseRemaining(); wait > 0 {
+		_, pauseSpan := c.tracer.Start(ctx, "throttlingTransport.secondary_limit_pause")
+		time.Sleep(wait)
+		pauseSpan.End()
+	}
+
 	outboundConcurrencyGauge.Inc()
 	defer outboundConcurrencyGauge.Dec()
-	return c.delegate.RoundTrip(req)
+	resp, err := c.delegate.RoundTrip(req)
+	if err != nil {
+		span.RecordError(err)
+		return resp, err
+	}
+	budget.observe(c.maxConcurrency, budgetName, resp)
+	return resp, nil
 }
 
 // upstreamTransport changes response headers from upstream before they
@@ -171,17 +746,54 @@ func (c *throttlingTransport) RoundTrip(req *http.Request) (*http.Response, erro
 //    Cache-Control: no-cache
 // This instructs the cache to store the response, but always consider it stale.
 type upstreamTransport struct {
-	delegate http.RoundTripper
-	hasher   ghmetrics.Hasher
+	delegate            http.RoundTripper
+	hasher              ghmetrics.Hasher
+	tracer              trace.Tracer
+	negativeTTL         time.Duration
+	negativeStatusCodes map[int]bool
+}
+
+// tokenBudgetIdentifier returns the name of the token budget a request
+// should be accounted against: the explicit header if the caller set one,
+// otherwise a hash of the request's Authorization header.
+func tokenBudgetIdentifier(req *http.Request, hasher ghmetrics.Hasher) string {
+	if val := req.Header.Get(TokenBudgetIdentifierHeader); val != "" {
+		return val
+	}
+	return hasher.Hash(req)
 }
 
 func (u upstreamTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := u.tracer.Start(req.Context(), "upstreamTransport.RoundTrip")
+	defer span.End()
+	req = req.WithContext(ctx)
+
 	etag := req.Header.Get("if-none-match")
-	var tokenBudgetName string
-	if val := req.Header.Get(TokenBudgetIdentifierHeader); val != "" {
-		tokenBudgetName = val
-	} else {
-		tokenBudgetName = u.hasher.Hash(req)
+	tokenBudgetName := tokenBudgetIdentifier(req, u.hasher)
+	span.SetAttributes(
+		attribute.String("cache.mode", string(cacheRequestMode(req))),
+		attribute.String("token.budget", tokenBudgetName),
+		attribute.String("github.path", req.URL.Path),
+	)
+
+	switch mode := cacheRequestMode(req); mode {
+	case CacheRequestModeBypass, CacheRequestModeBypassRequest:
+		// Force a fresh fetch by discarding whatever the cache believes is
+		// still valid; the fresh response is stored as usual below.
+		req = req.Clone(req.Context())
+		req.Header.Del("If-None-Match")
+		req.Header.Del("If-Modified-Since")
+		etag = ""
+	case CacheRequestModeBypassResponse, CacheRequestModeStrict:
+		if etag != "" || req.Header.Get("If-Modified-Since") != "" {
+			// A cache entry already exists (httpcache sent one of its
+			// validators): tell httpcache it's still valid instead of
+			// spending an upstream request to confirm that.
+			return syntheticNotModified(req), nil
+		}
+		if mode == CacheRequestModeStrict {
+			return nil, fmt.Errorf("no cache entry for %s and %s=%s was set", req.URL, CacheRequestModeHeader, mode)
+		}
 	}
 
 	reqStartTime := time.Now()
@@ -190,14 +802,32 @@ func (u upstreamTransport) RoundTrip(req *http.Request) (*http.Response, error)
 	if err != nil {
 		ghmetrics.CollectRequestTimeoutMetrics(tokenBudgetName, req.URL.Path, req.Header.Get("User-Agent"), reqStartTime, time.Now())
 		logrus.WithField("cache-key", req.URL.String()).WithError(err).Warn("Error from upstream (GitHub).")
+		span.RecordError(err)
 		return nil, err
 	}
 	responseTime := time.Now()
 	roundTripTime := responseTime.Sub(reqStartTime)
 
 	if resp.StatusCode >= 400 {
-		// Don't store errors. They can't be revalidated to save API tokens.
-		resp.Header.Set("Cache-Control", "no-store")
+		if u.negativeStatusCodes[resp.StatusCode] {
+			// GitHub doesn't honor conditional requests for missing
+			// resources, so a known-missing PR/comment/branch would
+			// otherwise burn a token on every re-query. Cache it with a
+			// short, real TTL instead of marking it no-store.
+			ttl := u.negativeTTL
+			if override := req.Header.Get(NegativeTTLHeader); override != "" {
+				if d, err := time.ParseDuration(override); err == nil {
+					ttl = d
+				}
+			}
+			resp.Header.Set("Cache-Control", fmt.Sprintf("max-age=%d", int(ttl.Seconds())))
+			resp.Header.Set("Expires", responseTime.Add(ttl).UTC().Format(http.TimeFormat))
+			resp.Header.Set(negativeCacheHeader, "true")
+			resp.Header.Set(cacheEntryCreationDateHeader, strconv.Itoa(int(time.Now().Unix())))
+		} else {
+			// Don't store errors. They can't be revalidated to save API tokens.
+			resp.Header.Set("Cache-Control", "no-store")
+		}
 	} else {
 		resp.Header.Set("Cache-Control", "no-cache")
 		if resp.StatusCode != http.StatusNotModified {
@@ -214,6 +844,10 @@ func (u upstreamTransport) RoundTrip(req *http.Request) (*http.Response, error)
 		resp.Header.Set("Cache-Control", "no-store")
 		apiVersion = "v4"
 	}
+	span.SetAttributes(
+		attribute.String("github.api_version", apiVersion),
+		attribute.String("ratelimit.remaining", resp.Header.Get("X-RateLimit-Remaining")),
+	)
 
 	ghmetrics.CollectGitHubTokenMetrics(tokenBudgetName, apiVersion, resp.Header, reqStartTime, responseTime)
 	ghmetrics.CollectGitHubRequestMetrics(tokenBudgetName, req.URL.Path, strconv.Itoa(resp.StatusCode), req.Header.Get("User-Agent"), roundTripTime.Seconds())
@@ -346,36 +980,611 @@ func NewMemCache(delegate http.RoundTripper, maxConcurrency int) http.RoundTripp
 		maxConcurrency)
 }
 
+// NewTwoTierCache creates a GitHub cache RoundTripper backed by a bounded
+// in-memory LRU in front of the existing diskv-backed disk cache. Hot,
+// frequently-revalidated paths (issues, PRs, refs) are served from memory
+// instead of paying a disk read on every conditional request; misses fall
+// through to disk and promote into the LRU. Each partition gets its own LRU
+// shard, keyed under the partition prefix, so one token's working set can't
+// evict another's.
+func NewTwoTierCache(delegate http.RoundTripper, cacheDir string, cacheSizeGB, maxConcurrency int, cachePruneInterval time.Duration, lruMaxEntries int, lruMaxBytes int64) http.RoundTripper {
+	go func() {
+		for range time.NewTicker(cachePruneInterval).C {
+			Prune(cacheDir, time.Now)
+		}
+	}()
+
+	cache, err := (twoTierBackend{}).NewCache(map[string]string{
+		"dir":             cacheDir,
+		"size_gb":         strconv.Itoa(cacheSizeGB),
+		"lru_max_entries": strconv.Itoa(lruMaxEntries),
+		"lru_max_bytes":   strconv.FormatInt(lruMaxBytes, 10),
+	})
+	if err != nil {
+		logrus.WithError(err).Fatal("Failed to construct two-tier cache")
+	}
+	return NewFromCache(delegate, cache, maxConcurrency)
+}
+
+// twoTierBackend adapts NewTwoTierCache's cache creation into the Backend
+// interface.
+type twoTierBackend struct{}
+
+func (twoTierBackend) NewCache(config map[string]string) (CachePartitionCreator, error) {
+	cacheDir := config["dir"]
+	if cacheDir == "" {
+		return nil, errors.New(`twotier backend requires a "dir" config value`)
+	}
+	cacheSizeGB, err := strconv.Atoi(config["size_gb"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid twotier backend %q config value %q: %w", "size_gb", config["size_gb"], err)
+	}
+	lruMaxEntries, err := strconv.Atoi(config["lru_max_entries"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid twotier backend %q config value %q: %w", "lru_max_entries", config["lru_max_entries"], err)
+	}
+	lruMaxBytes, err := strconv.ParseInt(config["lru_max_bytes"], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid twotier backend %q config value %q: %w", "lru_max_bytes", config["lru_max_bytes"], err)
+	}
+
+	return func(partitionKey string, expiresAt *time.Time) httpcache.Cache {
+		basePath := path.Join(cacheDir, "data", partitionKey)
+		tempDir := path.Join(cacheDir, "temp", partitionKey)
+		if err := writecachePartitionMetadata(basePath, tempDir, expiresAt); err != nil {
+			logrus.WithError(err).Warn("Failed to write cache metadata file, pruning will not work")
+		}
+		disk := diskcache.NewWithDiskv(diskv.New(diskv.Options{
+			BasePath:     basePath,
+			TempDir:      tempDir,
+			CacheSizeMax: uint64(cacheSizeGB) * uint64(1000000000), // convert G to B
+		}))
+		return &twoTierCache{disk: disk, lru: newLRUCache(partitionKey, lruMaxEntries, lruMaxBytes)}
+	}, nil
+}
+
+// twoTierCache wraps a bounded in-memory LRU in front of a disk-backed
+// httpcache.Cache, promoting entries into the LRU on disk hits and writing
+// through to disk on every set so the disk tier always has the full data
+// set for Prune and restarts.
+type twoTierCache struct {
+	disk httpcache.Cache
+	lru  *lruCache
+}
+
+func (c *twoTierCache) Get(key string) ([]byte, bool) {
+	if b, ok := c.lru.get(key); ok {
+		tierHitsCounter.WithLabelValues("mem").Inc()
+		return b, true
+	}
+	b, ok := c.disk.Get(key)
+	if !ok {
+		return nil, false
+	}
+	tierHitsCounter.WithLabelValues("disk").Inc()
+	c.lru.set(key, b)
+	return b, true
+}
+
+func (c *twoTierCache) Set(key string, responseBytes []byte) {
+	c.lru.set(key, responseBytes)
+	c.disk.Set(key, responseBytes)
+}
+
+func (c *twoTierCache) Delete(key string) {
+	c.lru.delete(key)
+	c.disk.Delete(key)
+}
+
+// lruCache is a bounded, count- and byte-size-limited least-recently-used
+// cache of response bytes, scoped to a single cache partition for metrics
+// purposes.
+type lruCache struct {
+	partition  string
+	maxEntries int
+	maxBytes   int64
+
+	mu    sync.Mutex
+	ll    *list.List
+	items map[string]*list.Element
+	bytes int64
+}
+
+type lruEntry struct {
+	key   string
+	value []byte
+}
+
+func newLRUCache(partition string, maxEntries int, maxBytes int64) *lruCache {
+	return &lruCache{
+		partition:  partition,
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		ll:         list.New(),
+		items:      map[string]*list.Element{},
+	}
+}
+
+func (c *lruCache) get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	return el.Value.(*lruEntry).value, true
+}
+
+func (c *lruCache) set(key string, value []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.bytes += int64(len(value)) - int64(len(el.Value.(*lruEntry).value))
+		el.Value.(*lruEntry).value = value
+		c.ll.MoveToFront(el)
+	} else {
+		el := c.ll.PushFront(&lruEntry{key: key, value: value})
+		c.items[key] = el
+		c.bytes += int64(len(value))
+	}
+	c.evictLocked()
+	tierBytesGauge.WithLabelValues(c.partition).Set(float64(c.bytes))
+}
+
+func (c *lruCache) delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.removeElementLocked(el)
+	}
+	tierBytesGauge.WithLabelValues(c.partition).Set(float64(c.bytes))
+}
+
+// evictLocked removes the least-recently-used entries until both the entry
+// count and byte-size budgets are satisfied. c.mu must be held.
+func (c *lruCache) evictLocked() {
+	for (c.maxEntries > 0 && c.ll.Len() > c.maxEntries) || (c.maxBytes > 0 && c.bytes > c.maxBytes) {
+		oldest := c.ll.Back()
+		if oldest == nil {
+			break
+		}
+		c.removeElementLocked(oldest)
+	}
+}
+
+func (c *lruCache) removeElementLocked(el *list.Element) {
+	entry := el.Value.(*lruEntry)
+	c.ll.Remove(el)
+	delete(c.items, entry.key)
+	c.bytes -= int64(len(entry.value))
+}
+
+func init() {
+	RegisterBackend("twotier", twoTierBackend{})
+}
+
 // CachePartitionCreator creates a new cache partition using the given key
 type CachePartitionCreator func(partitionKey string, expiresAt *time.Time) httpcache.Cache
 
+// Backend constructs a CachePartitionCreator for a named cache
+// implementation from a set of string options. It lets operators plug in
+// cache storage layers ghcache doesn't know about ahead of time (BadgerDB,
+// S3, a two-tier cache, ...) by registering a Backend under a name and
+// selecting it via NewFromBackend, instead of requiring a dedicated
+// NewXCache constructor for every storage layer.
+type Backend interface {
+	NewCache(config map[string]string) (CachePartitionCreator, error)
+}
+
+var (
+	backendsMu sync.RWMutex
+	backends   = map[string]Backend{}
+)
+
+// RegisterBackend makes a Backend available under name, for later lookup by
+// NewFromBackend. Backends are expected to register themselves from an
+// init function.
+func RegisterBackend(name string, backend Backend) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	backends[name] = backend
+}
+
+// BackendByName looks up a Backend previously registered with
+// RegisterBackend.
+func BackendByName(name string) (Backend, bool) {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+	b, ok := backends[name]
+	return b, ok
+}
+
+// NewFromBackend creates a GitHub cache RoundTripper using the named,
+// registered Backend to construct its CachePartitionCreator.
+func NewFromBackend(delegate http.RoundTripper, backendName string, backendConfig map[string]string, maxConcurrency int, opts ...Option) (http.RoundTripper, error) {
+	backend, ok := BackendByName(backendName)
+	if !ok {
+		return nil, fmt.Errorf("no cache backend registered under name %q", backendName)
+	}
+	cache, err := backend.NewCache(backendConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to construct %q cache backend: %w", backendName, err)
+	}
+	return NewFromCache(delegate, cache, maxConcurrency, opts...), nil
+}
+
+func init() {
+	RegisterBackend("memory", memoryBackend{})
+	RegisterBackend("disk", diskBackend{})
+}
+
+// memoryBackend adapts NewMemCache's cache creation into the Backend
+// interface.
+type memoryBackend struct{}
+
+func (memoryBackend) NewCache(_ map[string]string) (CachePartitionCreator, error) {
+	return func(_ string, _ *time.Time) httpcache.Cache { return httpcache.NewMemoryCache() }, nil
+}
+
+// diskBackend adapts NewDiskCache's (partitioned) cache creation into the
+// Backend interface.
+type diskBackend struct{}
+
+func (diskBackend) NewCache(config map[string]string) (CachePartitionCreator, error) {
+	cacheDir := config["dir"]
+	if cacheDir == "" {
+		return nil, errors.New(`disk backend requires a "dir" config value`)
+	}
+	cacheSizeGB, err := strconv.Atoi(config["size_gb"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid disk backend %q config value %q: %w", "size_gb", config["size_gb"], err)
+	}
+
+	return func(partitionKey string, expiresAt *time.Time) httpcache.Cache {
+		basePath := path.Join(cacheDir, "data", partitionKey)
+		tempDir := path.Join(cacheDir, "temp", partitionKey)
+		if err := writecachePartitionMetadata(basePath, tempDir, expiresAt); err != nil {
+			logrus.WithError(err).Warn("Failed to write cache metadata file, pruning will not work")
+		}
+		return diskcache.NewWithDiskv(
+			diskv.New(diskv.Options{
+				BasePath:     basePath,
+				TempDir:      tempDir,
+				CacheSizeMax: uint64(cacheSizeGB) * uint64(1000000000), // convert G to B
+			}))
+	}, nil
+}
+
 // NewFromCache creates a GitHub cache RoundTripper that is backed by the
 // specified httpcache.Cache implementation.
-func NewFromCache(delegate http.RoundTripper, cache CachePartitionCreator, maxConcurrency int) http.RoundTripper {
+func NewFromCache(delegate http.RoundTripper, cache CachePartitionCreator, maxConcurrency int, opts ...Option) http.RoundTripper {
+	cfg := defaultConfig()
+	for _, opt := range opts {
+		opt(&cfg)
+	}
 	hasher := ghmetrics.NewCachingHasher()
-	return newPartitioningRoundTripper(func(partitionKey string, expiresAt *time.Time) http.RoundTripper {
+	tracer := cfg.tracerProvider.Tracer(tracerName)
+	return newPartitioningRoundTripper(hasher, func(partitionKey string, expiresAt *time.Time) http.RoundTripper {
 		cacheTransport := httpcache.NewTransport(cache(partitionKey, expiresAt))
-		cacheTransport.Transport = newThrottlingTransport(maxConcurrency, upstreamTransport{delegate: delegate, hasher: hasher})
+		// cacheResponseMode needs to tell a fresh, token-costing negative-
+		// cache write apart from a free, cache-only negative-cache read;
+		// both set negativeCacheHeader identically, so key that distinction
+		// off httpcache's own marker for "this response came from cache".
+		cacheTransport.MarkCachedResponses = true
+		upstream := upstreamTransport{
+			delegate:            delegate,
+			hasher:              hasher,
+			tracer:              tracer,
+			negativeTTL:         cfg.negative.ttl,
+			negativeStatusCodes: cfg.negative.statusCodes,
+		}
+		cacheTransport.Transport = newThrottlingTransport(maxConcurrency, hasher, upstream, tracer, cfg.throttling)
+		// requestCoalescer keys purely on the request (token budget + URL),
+		// not on the response it eventually gets, so simultaneous requests
+		// for a resource that turns out to be missing collapse onto a single
+		// upstream call exactly like any other coalesced request: the second
+		// caller copies the first's 404/410/422 (now negative-cached by
+		// upstreamTransport) instead of triggering its own round trip. It
+		// skips coalescing entirely for CacheRequestModeBypassRequest (and
+		// its alias CacheRequestModeBypass), since a forced refresh must not
+		// be handed to, or served from, another caller's in-flight
+		// conditional request.
 		return &requestCoalescer{
 			keys:     make(map[string]*responseWaiter),
 			delegate: cacheTransport,
 			hasher:   hasher,
+			tracer:   tracer,
 		}
 	})
 }
 
-// NewRedisCache creates a GitHub cache RoundTripper that is backed by a Redis
-// cache.
-// Important note: The redis implementation does not support partitioning the cache
-// which means that requests to the same path from different tokens will invalidate
-// each other.
-func NewRedisCache(delegate http.RoundTripper, redisAddress string, maxConcurrency int) http.RoundTripper {
-	conn, err := redis.Dial("tcp", redisAddress)
-	if err != nil {
+// RedisCacheOptions configures NewRedisCache's connection to Redis.
+type RedisCacheOptions struct {
+	// Addrs is the list of Redis server addresses. A single entry connects
+	// to a standalone instance; multiple entries select Redis Cluster mode
+	// unless SentinelMasterName is set, in which case they are treated as
+	// Sentinel addresses.
+	Addrs []string
+	// SentinelMasterName, if non-empty, connects through Sentinel using
+	// Addrs as the sentinel addresses and this as the monitored master's
+	// name.
+	SentinelMasterName string
+	Username           string
+	Password           string
+	EnableTLS          bool
+	PoolSize           int
+	// PruneInterval, if non-zero, starts a background sweep that calls
+	// PruneRedis on this interval. Redis already expires individual entries
+	// server-side via EXPIREAT, so this is only a belt-and-suspenders catch
+	// for the rare entry that outlives its TTL; leave it zero to skip the
+	// sweep entirely.
+	PruneInterval time.Duration
+}
+
+// redisPartitionMetadataKeySuffix marks the Redis key that stores a
+// partition's cachePartitionMetadata, mirroring cachePartitionMetadataFileName
+// for the disk backend.
+const redisPartitionMetadataKeySuffix = ":__meta__"
+
+// NewRedisCache creates a GitHub cache RoundTripper that is backed by a
+// Redis cache. Unlike the original redigo-based implementation, cache keys
+// are prefixed with the partition key so requests from different tokens no
+// longer invalidate each other, and entries carry a server-side EXPIREAT
+// derived from the token's expiry so Redis cleans up stale partitions on
+// its own; if opts.PruneInterval is set, PruneRedis also runs periodically
+// as a belt-and-suspenders sweep.
+func NewRedisCache(delegate http.RoundTripper, opts RedisCacheOptions, maxConcurrency int) http.RoundTripper {
+	client := newRedisClient(opts)
+	if err := client.Ping(context.Background()).Err(); err != nil {
 		logrus.WithError(err).Fatal("Error connecting to Redis")
 	}
-	redisCache := rediscache.NewWithClient(conn)
+	startRedisPruner(client, opts.PruneInterval)
+
 	return NewFromCache(delegate,
-		func(_ string, _ *time.Time) httpcache.Cache { return redisCache },
+		func(partitionKey string, expiresAt *time.Time) httpcache.Cache {
+			return &redisCache{client: client, partitionKey: partitionKey, expiresAt: expiresAt}
+		},
 		maxConcurrency)
 }
+
+func newRedisClient(opts RedisCacheOptions) goredis.UniversalClient {
+	redisOpts := &goredis.UniversalOptions{
+		Addrs:      opts.Addrs,
+		MasterName: opts.SentinelMasterName,
+		Username:   opts.Username,
+		Password:   opts.Password,
+		PoolSize:   opts.PoolSize,
+	}
+	if opts.EnableTLS {
+		redisOpts.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	return goredis.NewUniversalClient(redisOpts)
+}
+
+// startRedisPruner starts the PruneRedis sweep on a ticker, mirroring how
+// NewDiskCache/NewTwoTierCache wire Prune. A zero interval disables it.
+func startRedisPruner(client goredis.UniversalClient, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		for range time.NewTicker(interval).C {
+			if err := PruneRedis(context.Background(), client, time.Now); err != nil {
+				logrus.WithError(err).Warn("Failed to prune redis cache")
+			}
+		}
+	}()
+}
+
+// redisBackend adapts NewRedisCache's cache creation into the Backend
+// interface. Addrs in config are given as a comma-separated list.
+type redisBackend struct{}
+
+func (redisBackend) NewCache(config map[string]string) (CachePartitionCreator, error) {
+	if config["addrs"] == "" {
+		return nil, errors.New(`redis backend requires an "addrs" config value`)
+	}
+	opts := RedisCacheOptions{
+		Addrs:              strings.Split(config["addrs"], ","),
+		SentinelMasterName: config["sentinel_master_name"],
+		Username:           config["username"],
+		Password:           config["password"],
+	}
+	if config["tls"] != "" {
+		enableTLS, err := strconv.ParseBool(config["tls"])
+		if err != nil {
+			return nil, fmt.Errorf("invalid redis backend %q config value %q: %w", "tls", config["tls"], err)
+		}
+		opts.EnableTLS = enableTLS
+	}
+	if config["pool_size"] != "" {
+		poolSize, err := strconv.Atoi(config["pool_size"])
+		if err != nil {
+			return nil, fmt.Errorf("invalid redis backend %q config value %q: %w", "pool_size", config["pool_size"], err)
+		}
+		opts.PoolSize = poolSize
+	}
+	if config["prune_interval"] != "" {
+		pruneInterval, err := time.ParseDuration(config["prune_interval"])
+		if err != nil {
+			return nil, fmt.Errorf("invalid redis backend %q config value %q: %w", "prune_interval", config["prune_interval"], err)
+		}
+		opts.PruneInterval = pruneInterval
+	}
+
+	client := newRedisClient(opts)
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		return nil, fmt.Errorf("error connecting to Redis: %w", err)
+	}
+	startRedisPruner(client, opts.PruneInterval)
+
+	return func(partitionKey string, expiresAt *time.Time) httpcache.Cache {
+		return &redisCache{client: client, partitionKey: partitionKey, expiresAt: expiresAt}
+	}, nil
+}
+
+func init() {
+	RegisterBackend("redis", redisBackend{})
+}
+
+// redisCache implements httpcache.Cache on top of a go-redis client,
+// prefixing every key with the cache partition so different tokens can
+// share a single Redis instance (or Cluster/Sentinel deployment) without
+// clobbering each other.
+type redisCache struct {
+	client       goredis.UniversalClient
+	partitionKey string
+	expiresAt    *time.Time
+}
+
+// partitionHashTag wraps a partition key in a Redis Cluster hash tag
+// (`{...}`), forcing every key built from it onto the same hash slot. That
+// is what lets scanDeleteRedisPrefix's multi-key DEL for a partition succeed
+// against a real Cluster instead of failing with CROSSSLOT.
+func partitionHashTag(partitionKey string) string {
+	return "{" + partitionKey + "}"
+}
+
+func (c *redisCache) key(key string) string {
+	return partitionHashTag(c.partitionKey) + ":" + key
+}
+
+func (c *redisCache) Get(key string) ([]byte, bool) {
+	b, err := c.client.Get(context.Background(), c.key(key)).Bytes()
+	if err != nil {
+		return nil, false
+	}
+	return b, true
+}
+
+func (c *redisCache) Set(key string, responseBytes []byte) {
+	ctx := context.Background()
+	fullKey := c.key(key)
+	if err := c.client.Set(ctx, fullKey, responseBytes, 0).Err(); err != nil {
+		logrus.WithError(err).WithField("cache-key", fullKey).Warn("Failed to write redis cache entry")
+		return
+	}
+	if c.expiresAt == nil {
+		// No expiry header was passed for this token, likely a PAT which
+		// never expires; leave the entry without a TTL and write no
+		// partition metadata, same as the disk backend's
+		// writecachePartitionMetadata.
+		return
+	}
+	if err := c.client.ExpireAt(ctx, fullKey, *c.expiresAt).Err(); err != nil {
+		logrus.WithError(err).WithField("cache-key", fullKey).Warn("Failed to set redis cache entry expiry")
+	}
+	c.writeMetadata(ctx)
+}
+
+func (c *redisCache) writeMetadata(ctx context.Context) {
+	metaKey := partitionHashTag(c.partitionKey) + redisPartitionMetadataKeySuffix
+	serialized, err := json.Marshal(cachePartitionMetadata{ExpiresAt: metav1.Time{Time: *c.expiresAt}})
+	if err != nil {
+		logrus.WithError(err).Warn("Failed to serialize redis partition metadata")
+		return
+	}
+	if err := c.client.Set(ctx, metaKey, serialized, 0).Err(); err != nil {
+		logrus.WithError(err).WithField("cache-key", metaKey).Warn("Failed to write redis partition metadata")
+		return
+	}
+	if err := c.client.ExpireAt(ctx, metaKey, *c.expiresAt).Err(); err != nil {
+		logrus.WithError(err).WithField("cache-key", metaKey).Warn("Failed to set redis partition metadata expiry")
+	}
+}
+
+func (c *redisCache) Delete(key string) {
+	if err := c.client.Del(context.Background(), c.key(key)).Err(); err != nil {
+		logrus.WithError(err).WithField("cache-key", c.key(key)).Warn("Failed to delete redis cache entry")
+	}
+}
+
+// forEachNode runs fn against every master node that can serve a SCAN. A
+// standalone or Sentinel-backed client has just the one node; a
+// *goredis.ClusterClient shards keys across several, and a bare Scan call on
+// it only walks whichever single node it happens to route to, silently
+// missing data on every other shard. ForEachMaster is the Cluster-aware way
+// to cover all of them.
+func forEachNode(ctx context.Context, client goredis.UniversalClient, fn func(ctx context.Context, node goredis.Cmdable) error) error {
+	if cluster, ok := client.(*goredis.ClusterClient); ok {
+		return cluster.ForEachMaster(ctx, func(ctx context.Context, master *goredis.Client) error {
+			return fn(ctx, master)
+		})
+	}
+	return fn(ctx, client)
+}
+
+// PruneRedis scans client for partition metadata written by redisCache.Set
+// and deletes the entries of any partition whose expiry has passed,
+// matching the guarantees Prune provides for the disk backend. Redis
+// already expires individual entries server-side via EXPIREAT, so this is
+// a belt-and-suspenders sweep for the rare entry that outlives its TTL.
+func PruneRedis(ctx context.Context, client goredis.UniversalClient, now func() time.Time) error {
+	var errs []error
+	err := forEachNode(ctx, client, func(ctx context.Context, node goredis.Cmdable) error {
+		var cursor uint64
+		for {
+			metaKeys, next, err := node.Scan(ctx, cursor, "*"+redisPartitionMetadataKeySuffix, 100).Result()
+			if err != nil {
+				return fmt.Errorf("failed to scan redis partition metadata: %w", err)
+			}
+
+			for _, metaKey := range metaKeys {
+				raw, err := node.Get(ctx, metaKey).Bytes()
+				if err != nil {
+					continue
+				}
+				var metadata cachePartitionMetadata
+				if err := json.Unmarshal(raw, &metadata); err != nil {
+					errs = append(errs, fmt.Errorf("failed to deserialize metadata for %q: %w", metaKey, err))
+					continue
+				}
+				if metadata.ExpiresAt.After(now()) {
+					continue
+				}
+				partitionTag := strings.TrimSuffix(metaKey, redisPartitionMetadataKeySuffix)
+				logrus.WithField("partition", partitionTag).WithField("expiresAt", metadata.ExpiresAt.String()).Info("Cleaning up expired redis cache partition")
+				if err := scanDeleteRedisPrefix(ctx, client, partitionTag+":"); err != nil {
+					errs = append(errs, fmt.Errorf("failed to prune partition %q: %w", partitionTag, err))
+				}
+			}
+
+			cursor = next
+			if cursor == 0 {
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		errs = append(errs, err)
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// scanDeleteRedisPrefix deletes every key matching prefix+"*". Every key
+// under a single partition's prefix shares that partition's hash tag (see
+// partitionHashTag), so they all live on the same Cluster slot and a
+// multi-key DEL across the keys found on one node is safe.
+func scanDeleteRedisPrefix(ctx context.Context, client goredis.UniversalClient, prefix string) error {
+	return forEachNode(ctx, client, func(ctx context.Context, node goredis.Cmdable) error {
+		var cursor uint64
+		for {
+			keys, next, err := node.Scan(ctx, cursor, prefix+"*", 100).Result()
+			if err != nil {
+				return err
+			}
+			if len(keys) > 0 {
+				if err := node.Del(ctx, keys...).Err(); err != nil {
+					return err
+				}
+			}
+			cursor = next
+			if cursor == 0 {
+				break
+			}
+		}
+		return nil
+	})
+}
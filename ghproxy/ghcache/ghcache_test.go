@@ -0,0 +1,56 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ghcache
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gregjones/httpcache"
+)
+
+func TestCacheResponseModeNegativeCacheWriteIsNotFree(t *testing.T) {
+	// The response that first populates a negative-cache entry sets
+	// negativeCacheHeader but was never served from httpcache's cache, so
+	// it must not be classified as a free ModeNegative hit.
+	headers := http.Header{}
+	headers.Set(negativeCacheHeader, "true")
+
+	mode := cacheResponseMode(headers)
+	if mode != ModeMiss {
+		t.Fatalf("cacheResponseMode(write) = %s, want %s", mode, ModeMiss)
+	}
+	if CacheModeIsFree(mode) {
+		t.Fatal("a fresh negative-cache write must not be reported as free")
+	}
+}
+
+func TestCacheResponseModeNegativeCacheReadIsFree(t *testing.T) {
+	// A subsequent cache-only read of that same entry carries both
+	// negativeCacheHeader and httpcache's XFromCache marker.
+	headers := http.Header{}
+	headers.Set(negativeCacheHeader, "true")
+	headers.Set(httpcache.XFromCache, "1")
+
+	mode := cacheResponseMode(headers)
+	if mode != ModeNegative {
+		t.Fatalf("cacheResponseMode(read) = %s, want %s", mode, ModeNegative)
+	}
+	if !CacheModeIsFree(mode) {
+		t.Fatal("a negative-cache read should be reported as free")
+	}
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ghcache
+
+import "testing"
+
+func TestLRUCacheGetSet(t *testing.T) {
+	c := newLRUCache("test", 10, 0)
+
+	if _, ok := c.get("a"); ok {
+		t.Fatal("get on empty cache should miss")
+	}
+
+	c.set("a", []byte("1"))
+	b, ok := c.get("a")
+	if !ok || string(b) != "1" {
+		t.Fatalf("get(a) = %q, %v; want \"1\", true", b, ok)
+	}
+
+	c.set("a", []byte("2"))
+	b, ok = c.get("a")
+	if !ok || string(b) != "2" {
+		t.Fatalf("get(a) after overwrite = %q, %v; want \"2\", true", b, ok)
+	}
+}
+
+func TestLRUCacheEvictsLeastRecentlyUsedByCount(t *testing.T) {
+	c := newLRUCache("test", 2, 0)
+
+	c.set("a", []byte("1"))
+	c.set("b", []byte("1"))
+	// Touch "a" so "b" becomes the least recently used entry.
+	c.get("a")
+	c.set("c", []byte("1"))
+
+	if _, ok := c.get("b"); ok {
+		t.Fatal("b should have been evicted as the least recently used entry")
+	}
+	if _, ok := c.get("a"); !ok {
+		t.Fatal("a was recently used and should not have been evicted")
+	}
+	if _, ok := c.get("c"); !ok {
+		t.Fatal("c was just inserted and should not have been evicted")
+	}
+}
+
+func TestLRUCacheEvictsByByteSize(t *testing.T) {
+	c := newLRUCache("test", 0, 10)
+
+	c.set("a", []byte("12345"))
+	c.set("b", []byte("12345"))
+	// Pushes total bytes to 15, over the 10 byte budget; "a" must go.
+	c.set("c", []byte("12345"))
+
+	if _, ok := c.get("a"); ok {
+		t.Fatal("a should have been evicted once the byte budget was exceeded")
+	}
+	if c.bytes > 10 {
+		t.Fatalf("cache bytes = %d, want <= 10", c.bytes)
+	}
+}
+
+func TestLRUCacheDelete(t *testing.T) {
+	c := newLRUCache("test", 10, 0)
+
+	c.set("a", []byte("1"))
+	c.delete("a")
+
+	if _, ok := c.get("a"); ok {
+		t.Fatal("get after delete should miss")
+	}
+	if c.bytes != 0 {
+		t.Fatalf("cache bytes after deleting its only entry = %d, want 0", c.bytes)
+	}
+}
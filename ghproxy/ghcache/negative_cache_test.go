@@ -0,0 +1,124 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ghcache
+
+import (
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gregjones/httpcache"
+)
+
+// countingNotFoundDelegate always answers with 404, as GitHub does for a
+// still-missing resource, and counts how many times it was actually called.
+// Like GitHub, it sets a Date header: httpcache treats an entry without one
+// as stale.
+type countingNotFoundDelegate struct {
+	mu    sync.Mutex
+	calls int
+}
+
+func (d *countingNotFoundDelegate) RoundTrip(req *http.Request) (*http.Response, error) {
+	d.mu.Lock()
+	d.calls++
+	d.mu.Unlock()
+	return &http.Response{
+		Status:     "404 Not Found",
+		StatusCode: http.StatusNotFound,
+		Proto:      req.Proto,
+		ProtoMajor: req.ProtoMajor,
+		ProtoMinor: req.ProtoMinor,
+		Header:     http.Header{"Date": []string{time.Now().UTC().Format(http.TimeFormat)}},
+		Body:       http.NoBody,
+		Request:    req,
+	}, nil
+}
+
+func (d *countingNotFoundDelegate) callCount() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.calls
+}
+
+// TestNegativeCacheRefreshesAcrossTTLExpiry exercises a negative-cache entry
+// through httpcache.Transport end-to-end across two TTL windows. It guards
+// against a regression where httpcache's revalidation returns the stale
+// cached response directly without ever calling Cache.Set again, which would
+// leave a negative-cache entry permanently stale after its first TTL window:
+// every later request would both cost a real upstream call and still serve
+// the original (by-then ancient) stale entry.
+func TestNegativeCacheRefreshesAcrossTTLExpiry(t *testing.T) {
+	// Date and max-age both have one-second resolution, so the TTL must be
+	// whole seconds and long enough that the rounding of Date down to the
+	// second can't by itself expire the entry.
+	ttl := 2 * time.Second
+	delegate := &countingNotFoundDelegate{}
+	rt := NewFromCache(delegate,
+		func(_ string, _ *time.Time) httpcache.Cache { return httpcache.NewMemoryCache() },
+		1,
+		WithNegativeCacheTTL(ttl),
+	)
+
+	doGet := func() *http.Response {
+		req, err := http.NewRequest(http.MethodGet, "https://api.github.com/repos/foo/bar/pulls/1", nil)
+		if err != nil {
+			t.Fatalf("NewRequest: %v", err)
+		}
+		resp, err := rt.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("RoundTrip: %v", err)
+		}
+		ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		return resp
+	}
+
+	// First request: nothing cached yet, so this must reach the delegate
+	// and populate the negative-cache entry.
+	doGet()
+	if got := delegate.callCount(); got != 1 {
+		t.Fatalf("after first request, delegate calls = %d, want 1", got)
+	}
+
+	// Second request, still within the TTL window: must be served from the
+	// negative cache without another upstream call.
+	doGet()
+	if got := delegate.callCount(); got != 1 {
+		t.Fatalf("within the TTL window, delegate calls = %d, want 1 (served from cache)", got)
+	}
+
+	// Let the entry go stale, then issue a third request spanning the
+	// expiry: the entry must actually be refreshed, not just re-fetched
+	// and discarded.
+	time.Sleep(2 * ttl)
+	doGet()
+	if got := delegate.callCount(); got != 2 {
+		t.Fatalf("after the TTL expired, delegate calls = %d, want 2 (revalidated upstream)", got)
+	}
+
+	// A fourth request, immediately after the third and still within the
+	// new TTL window, must be served from the refreshed cache entry. If the
+	// revalidation in the previous step failed to update the cache, this
+	// would incorrectly reach the delegate again.
+	doGet()
+	if got := delegate.callCount(); got != 2 {
+		t.Fatalf("after the refresh, delegate calls = %d, want 2 (served from the refreshed entry)", got)
+	}
+}
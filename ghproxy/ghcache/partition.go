@@ -0,0 +1,77 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ghcache
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"k8s.io/test-infra/ghproxy/ghmetrics"
+)
+
+// partitioningRoundTripper lazily constructs one delegate RoundTripper per
+// cache partition, keyed by tokenBudgetIdentifier, so that a cache entry
+// written for one GitHub token is never served to a request authenticated
+// with a different one.
+type partitioningRoundTripper struct {
+	constructor func(partitionKey string, expiresAt *time.Time) http.RoundTripper
+	hasher      ghmetrics.Hasher
+
+	mu         sync.Mutex
+	partitions map[string]http.RoundTripper
+}
+
+func newPartitioningRoundTripper(hasher ghmetrics.Hasher, constructor func(partitionKey string, expiresAt *time.Time) http.RoundTripper) http.RoundTripper {
+	return &partitioningRoundTripper{
+		constructor: constructor,
+		hasher:      hasher,
+		partitions:  map[string]http.RoundTripper{},
+	}
+}
+
+func (p *partitioningRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	partitionKey := tokenBudgetIdentifier(req, p.hasher)
+	expiresAt := tokenExpiry(req)
+
+	p.mu.Lock()
+	rt, ok := p.partitions[partitionKey]
+	if !ok {
+		rt = p.constructor(partitionKey, expiresAt)
+		p.partitions[partitionKey] = rt
+		cachePartitionsCounter.WithLabelValues(partitionKey).Inc()
+	}
+	p.mu.Unlock()
+
+	return rt.RoundTrip(req)
+}
+
+// tokenExpiry parses TokenExpiryAtHeader off req, if set, so partitions
+// backed by a cache that supports server-side expiry (Redis) or sweep-based
+// pruning (disk, Redis) can clean themselves up once the token they cache
+// responses for no longer exists.
+func tokenExpiry(req *http.Request) *time.Time {
+	val := req.Header.Get(TokenExpiryAtHeader)
+	if val == "" {
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339, val)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
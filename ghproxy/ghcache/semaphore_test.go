@@ -0,0 +1,130 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ghcache
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestResizableSemaphoreAcquireRelease(t *testing.T) {
+	s := newResizableSemaphore(2)
+
+	if err := s.acquire(context.Background()); err != nil {
+		t.Fatalf("acquire 1: %v", err)
+	}
+	if err := s.acquire(context.Background()); err != nil {
+		t.Fatalf("acquire 2: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := s.acquire(ctx); err == nil {
+		t.Fatal("acquire should have blocked at capacity, but returned immediately")
+	}
+
+	s.release()
+	if err := s.acquire(context.Background()); err != nil {
+		t.Fatalf("acquire after release: %v", err)
+	}
+}
+
+func TestResizableSemaphoreSetCeilingShrink(t *testing.T) {
+	s := newResizableSemaphore(4)
+	s.setCeiling(2)
+
+	if err := s.acquire(context.Background()); err != nil {
+		t.Fatalf("acquire 1: %v", err)
+	}
+	if err := s.acquire(context.Background()); err != nil {
+		t.Fatalf("acquire 2: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := s.acquire(ctx); err == nil {
+		t.Fatal("acquire should have blocked at the shrunk ceiling of 2, but returned immediately")
+	}
+}
+
+func TestResizableSemaphoreSetCeilingGrow(t *testing.T) {
+	s := newResizableSemaphore(4)
+	s.setCeiling(1)
+
+	if err := s.acquire(context.Background()); err != nil {
+		t.Fatalf("acquire 1: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	if err := s.acquire(ctx); err == nil {
+		t.Fatal("acquire should have blocked at the ceiling of 1, but returned immediately")
+	}
+	cancel()
+
+	s.setCeiling(2)
+	if err := s.acquire(context.Background()); err != nil {
+		t.Fatalf("acquire after growing ceiling: %v", err)
+	}
+}
+
+func TestResizableSemaphoreSetCeilingShrinkDoesNotBlock(t *testing.T) {
+	s := newResizableSemaphore(2)
+
+	if err := s.acquire(context.Background()); err != nil {
+		t.Fatalf("acquire 1: %v", err)
+	}
+	if err := s.acquire(context.Background()); err != nil {
+		t.Fatalf("acquire 2: %v", err)
+	}
+
+	// Both slots are held, so there's no idle capacity to reserve from
+	// immediately. setCeiling must still return right away rather than
+	// blocking until a holder releases.
+	done := make(chan struct{})
+	go func() {
+		s.setCeiling(1)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(20 * time.Millisecond):
+		t.Fatal("setCeiling blocked instead of recording the shrink as debt")
+	}
+
+	// The shrink should take effect once a holder releases: the freed slot
+	// pays down the debt instead of becoming available to the next acquire.
+	s.release()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := s.acquire(ctx); err == nil {
+		t.Fatal("acquire should have blocked at the shrunk ceiling of 1, but returned immediately")
+	}
+}
+
+func TestResizableSemaphoreSetCeilingClamped(t *testing.T) {
+	s := newResizableSemaphore(3)
+
+	s.setCeiling(10)
+	if s.ceiling != 3 {
+		t.Fatalf("setCeiling(10) on a max-3 semaphore should clamp to 3, got %d", s.ceiling)
+	}
+
+	s.setCeiling(0)
+	if s.ceiling != 1 {
+		t.Fatalf("setCeiling(0) should clamp to a floor of 1, got %d", s.ceiling)
+	}
+}